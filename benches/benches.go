@@ -0,0 +1,67 @@
+package benches
+
+import (
+	"context"
+	"time"
+
+	"github.com/estesp/bucketbench/driver"
+)
+
+// Type identifies a specific benchmark implementation
+type Type int
+
+const (
+	// Custom identifies the YAML-driven CustomBench benchmark
+	Custom Type = iota
+)
+
+// State describes the lifecycle state of a benchmark run
+type State int
+
+const (
+	// Created indicates the benchmark has been initialized but not started
+	Created State = iota
+	// Running indicates the benchmark is currently executing
+	Running
+	// Completed indicates the benchmark ran to completion
+	Completed
+	// Aborted indicates the benchmark's context was canceled before all
+	// iterations completed; Stats() will contain whatever was collected
+	// up to that point, with the interrupted iteration marked Partial
+	Aborted
+)
+
+// RunStatistics captures the per-iteration timing and error results of a
+// benchmark run
+type RunStatistics struct {
+	Durations map[string]time.Duration
+	Errors    map[string]int
+	Timestamp time.Time
+	// Samples holds the resource usage readings collected while a "stats"/
+	// "metrics" command was active during this iteration, at the cadence
+	// set by CustomBench.SetSampleInterval
+	Samples []MetricSample
+	// Partial is true when this iteration was cut short by context
+	// cancellation before all of its commands finished
+	Partial bool
+}
+
+// Benchmark defines the interface all benchmark implementations must satisfy
+type Benchmark interface {
+	// Init initializes the benchmark
+	Init(ctx context.Context, name string, driverType driver.Type, binaryPath, imageInfo, cmdOverride string, trace bool) error
+	// Validate the unit of benchmark execution against the initialized driver
+	Validate(ctx context.Context) error
+	// Run executes the benchmark iterations against the initialized driver
+	Run(ctx context.Context, threads, iterations int, commands []string) error
+	// Stats returns the statistics of the benchmark run
+	Stats() []RunStatistics
+	// State returns the current lifecycle state of the benchmark
+	State() State
+	// Elapsed returns the time.Duration taken to run the benchmark
+	Elapsed() time.Duration
+	// Type returns the type of benchmark
+	Type() Type
+	// Info returns a string describing the driver backing the benchmark
+	Info(ctx context.Context) (string, error)
+}
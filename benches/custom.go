@@ -3,12 +3,12 @@ package benches
 import (
 	"context"
 	"fmt"
-	"io"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/estesp/bucketbench/driver"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -24,12 +24,24 @@ type CustomBench struct {
 	stats       []RunStatistics
 	elapsed     time.Duration
 	state       State
+	// sampleInterval governs how often a "stats"/"metrics" command samples
+	// the container's resource usage stream; defaults to defaultSampleInterval
+	sampleInterval time.Duration
+}
+
+// SetSampleInterval overrides the cadence at which "stats"/"metrics"
+// commands sample resource usage; must be called before Run
+func (cb *CustomBench) SetSampleInterval(interval time.Duration) {
+	cb.sampleInterval = interval
 }
 
 // Init initializes the benchmark
 func (cb *CustomBench) Init(ctx context.Context, name string, driverType driver.Type, binaryPath, imageInfo, cmdOverride string, trace bool) error {
 	cb.DriverType = driverType
 	cb.Path = binaryPath
+	if cb.RunID == "" {
+		cb.RunID = uuid.New().String()
+	}
 
 	driver, err := driver.New(ctx, &cb.Config)
 	if err != nil {
@@ -49,8 +61,9 @@ func (cb *CustomBench) Init(ctx context.Context, name string, driverType driver.
 
 	log.Infof("driver initialized: %s", info)
 
-	// prepare environment
-	err = driver.Clean(ctx)
+	// prepare environment: reap anything bucketbench-owned regardless of
+	// run-id, since a crashed prior run's containers won't carry cb.RunID
+	err = driver.Clean(ctx, false)
 	if err != nil {
 		return fmt.Errorf("error during driver init cleanup: %v", err)
 	}
@@ -126,9 +139,20 @@ func (cb *CustomBench) Run(ctx context.Context, threads, iterations int, command
 			cb.stats = append(cb.stats, statEntry)
 		}
 	}
-	cb.state = Completed
-	// final environment cleanup
-	if err := cb.driver.Clean(ctx); err != nil {
+	if ctx.Err() != nil {
+		log.Warnf("CustomBench run aborted: %v", ctx.Err())
+		cb.state = Aborted
+	} else {
+		cb.state = Completed
+	}
+	// final environment cleanup; use a fresh context so a canceled root
+	// context doesn't also block best-effort cleanup of what we started.
+	// Scoped to this run's own containers so a second, concurrently-running
+	// bucketbench invocation is left untouched (the Docker driver in ModeCLI
+	// ignores this scoping and matches by container name prefix).
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := cb.driver.Clean(cleanupCtx, true); err != nil {
 		return fmt.Errorf("Error during driver final cleanup: %v", err)
 	}
 	return nil
@@ -143,16 +167,13 @@ func (cb *CustomBench) runThread(ctx context.Context, runner driver.Driver, thre
 	}()
 
 	for i := 0; i < iterations; i++ {
+		if ctx.Err() != nil {
+			return
+		}
+
 		errors := make(map[string]int)
 		durations := make(map[string]time.Duration)
-		// commands are specified in the passed in array; we will need
-		// a container for each set of commands:
 		name := fmt.Sprintf("%s-%d-%d", driver.ContainerNamePrefix, threadNum, i)
-		ctr, err := runner.Create(ctx, name, cb.imageInfo, cb.cmdOverride, true, cb.trace)
-		if err != nil {
-			log.Errorf("Error on creating container %q from image %q: %v", name, cb.imageInfo, err)
-			return
-		}
 
 		log_error := func(cmd string, name string, err error, out string, elapsed time.Duration) {
 			if err != nil {
@@ -162,10 +183,42 @@ func (cb *CustomBench) runThread(ctx context.Context, runner driver.Driver, thre
 			durations[cmd] = elapsed
 			log.Debug(out)
 		}
+
+		coldPulled := false
+		if cb.CacheMode == driver.CacheCold {
+			out, rmElapsed, err := runner.RemoveImage(ctx, cb.imageInfo)
+			log_error("removeimage", name, err, out, rmElapsed)
+
+			// Create doesn't gate on a "pull" verb in commands, so in cold
+			// mode we have to pull ahead of it ourselves, unconditionally:
+			// Docker's ContainerCreate never auto-pulls (it would just fail
+			// against the image we removed above) even when the YAML never
+			// lists an explicit "pull" verb, and for containerd the cold
+			// pull cost needs to land on this timed step rather than get
+			// folded silently into Create's own internal pull.
+			out, pullElapsed, err := runner.Pull(ctx, cb.imageInfo)
+			log_error("pull", name, err, out, pullElapsed)
+			coldPulled = true
+		}
+
+		// commands are specified in the passed in array; we will need
+		// a container for each set of commands:
+		ctr, err := runner.Create(ctx, name, cb.imageInfo, cb.cmdOverride, true, cb.trace)
+		if err != nil {
+			log.Errorf("Error on creating container %q from image %q: %v", name, cb.imageInfo, err)
+			return
+		}
 		// Stats calls must be stopped at the end of current iteration if streaming
 		statsCtx, statsCancel := context.WithCancel(ctx)
+		var samplesWg sync.WaitGroup
+		var samples []MetricSample
 
+		var aborted bool
 		for _, cmd := range commands {
+			if ctx.Err() != nil {
+				aborted = true
+				break
+			}
 			// add binary expression
 			parts := strings.SplitN(cmd, " ", 2)
 			var args []string
@@ -176,6 +229,14 @@ func (cb *CustomBench) runThread(ctx context.Context, runner driver.Driver, thre
 			}
 			log.Debugf("running command: %s", cmd)
 			switch strings.ToLower(cmd) {
+			case "pull":
+				if coldPulled {
+					// already pulled ahead of Create above; running it
+					// again here would just re-time a warm no-op
+					continue
+				}
+				out, pullElapsed, err := runner.Pull(ctx, cb.imageInfo)
+				log_error(cmd, name, err, out, pullElapsed)
 			case "run", "start":
 				out, runElapsed, err := runner.Run(ctx, ctr)
 				log_error("run", name, err, out, runElapsed)
@@ -199,11 +260,15 @@ func (cb *CustomBench) runThread(ctx context.Context, runner driver.Driver, thre
 					errors["metrics"]++
 					log.Warnf("Error during container command %q on %q: %v", cmd, name, err)
 				} else {
+					samplesWg.Add(1)
 					go func() {
-						// We want to measure the overhead of collecting stats, we're not interested in stats data itself,
-						// so just discard the stream output
-						io.Copy(io.Discard, reader)
-						reader.Close()
+						defer samplesWg.Done()
+						defer reader.Close()
+						sampleCh := make(chan MetricSample, 16)
+						go collectSamples(runner.Type(), runner.Mode(), reader, cb.sampleInterval, sampleCh)
+						for sample := range sampleCh {
+							samples = append(samples, sample)
+						}
 					}()
 				}
 			case "execsync":
@@ -215,24 +280,44 @@ func (cb *CustomBench) runThread(ctx context.Context, runner driver.Driver, thre
 		}
 
 		statsCancel()
+		samplesWg.Wait()
+
+		if aborted {
+			// best-effort cleanup of the in-flight container on a fresh
+			// context, since ctx itself is already canceled
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if _, _, err := runner.Stop(cleanupCtx, ctr); err != nil {
+				log.Warnf("Error stopping container %q during abort cleanup: %v", name, err)
+			}
+			if _, _, err := runner.Remove(cleanupCtx, ctr); err != nil {
+				log.Warnf("Error removing container %q during abort cleanup: %v", name, err)
+			}
+			cancel()
+		}
 
 		stats <- RunStatistics{
 			Durations: durations,
 			Errors:    errors,
 			Timestamp: time.Now().UTC(),
+			Samples:   samples,
+			Partial:   aborted,
+		}
+
+		if aborted {
+			return
 		}
 	}
 }
 
 // Stats returns the statistics of the benchmark run
 func (cb *CustomBench) Stats() []RunStatistics {
-	if cb.state == Completed {
+	if cb.state == Completed || cb.state == Aborted {
 		return cb.stats
 	}
 	return []RunStatistics{}
 }
 
-// State returns Created, Running, or Completed
+// State returns Created, Running, Completed, or Aborted
 func (cb *CustomBench) State() State {
 	return cb.state
 }
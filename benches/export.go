@@ -0,0 +1,72 @@
+package benches
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WritePrometheusMetrics renders the samples collected across stats in
+// Prometheus text exposition format, so a run's resource pressure can be
+// scraped or fed into promtool/grafana alongside the CSV dump
+func WritePrometheusMetrics(w io.Writer, stats []RunStatistics) error {
+	metrics := []struct {
+		name string
+		help string
+		get  func(MetricSample) float64
+	}{
+		{"bucketbench_cpu_percent", "CPU usage percent sampled during the run", func(s MetricSample) float64 { return s.CPUPercent }},
+		{"bucketbench_memory_usage_bytes", "Memory usage in bytes sampled during the run", func(s MetricSample) float64 { return float64(s.MemoryUsageBytes) }},
+		{"bucketbench_memory_limit_bytes", "Memory limit in bytes sampled during the run", func(s MetricSample) float64 { return float64(s.MemoryLimitBytes) }},
+		{"bucketbench_blkio_bytes", "Cumulative block IO bytes sampled during the run", func(s MetricSample) float64 { return float64(s.BlkioBytes) }},
+		{"bucketbench_network_rx_bytes", "Cumulative network receive bytes sampled during the run", func(s MetricSample) float64 { return float64(s.NetworkRxBytes) }},
+		{"bucketbench_network_tx_bytes", "Cumulative network transmit bytes sampled during the run", func(s MetricSample) float64 { return float64(s.NetworkTxBytes) }},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+		for i, stat := range stats {
+			for _, sample := range stat.Samples {
+				if _, err := fmt.Fprintf(w, "%s{iteration=%q} %g %d\n", m.name, strconv.Itoa(i), m.get(sample), sample.Timestamp.UnixMilli()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// WriteSampleCSV renders the samples collected across stats as CSV, one row
+// per sample, so resource pressure can be correlated against lifecycle
+// latency (RunStatistics.Durations) offline
+func WriteSampleCSV(w io.Writer, stats []RunStatistics) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	header := []string{"iteration", "timestamp", "cpu_percent", "memory_usage_bytes", "memory_limit_bytes", "blkio_bytes", "network_rx_bytes", "network_tx_bytes"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for i, stat := range stats {
+		for _, sample := range stat.Samples {
+			row := []string{
+				strconv.Itoa(i),
+				sample.Timestamp.Format("2006-01-02T15:04:05.000Z07:00"),
+				strconv.FormatFloat(sample.CPUPercent, 'f', 2, 64),
+				strconv.FormatUint(sample.MemoryUsageBytes, 10),
+				strconv.FormatUint(sample.MemoryLimitBytes, 10),
+				strconv.FormatUint(sample.BlkioBytes, 10),
+				strconv.FormatUint(sample.NetworkRxBytes, 10),
+				strconv.FormatUint(sample.NetworkTxBytes, 10),
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Error()
+}
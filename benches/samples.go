@@ -0,0 +1,241 @@
+package benches
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/estesp/bucketbench/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultSampleInterval is used when a benchmark hasn't set one explicitly
+const defaultSampleInterval = 1 * time.Second
+
+// MetricSample captures a single point-in-time resource usage reading taken
+// from a container's stats stream during a benchmark iteration
+type MetricSample struct {
+	Timestamp        time.Time
+	CPUPercent       float64
+	MemoryUsageBytes uint64
+	MemoryLimitBytes uint64
+	BlkioBytes       uint64
+	NetworkRxBytes   uint64
+	NetworkTxBytes   uint64
+}
+
+// dockerStatsJSON mirrors the subset of Docker's types.StatsJSON this
+// package needs in order to compute CPU percent from the usage deltas and
+// to read memory, blkio and network usage; blkio and network are reported
+// as the stream's cumulative counters, not as per-sample deltas
+type dockerStatsJSON struct {
+	Read     time.Time `json:"read"`
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+		OnlineCPUs  uint64 `json:"online_cpus"`
+	} `json:"cpu_stats"`
+	PreCPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+	} `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64 `json:"usage"`
+		Limit uint64 `json:"limit"`
+	} `json:"memory_stats"`
+	BlkioStats struct {
+		IoServiceBytesRecursive []struct {
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+}
+
+// dockerCLIStatsJSON mirrors the pre-formatted, human-readable shape emitted
+// by `docker stats --format {{json .}}`; it shares no field names with the
+// raw Engine API's types.StatsJSON, so ModeCLI needs its own decode+parse path
+type dockerCLIStatsJSON struct {
+	CPUPerc  string `json:"CPUPerc"`
+	MemUsage string `json:"MemUsage"`
+	BlockIO  string `json:"BlockIO"`
+	NetIO    string `json:"NetIO"`
+}
+
+// containerdMetricsJSON is the wire format ContainerdNativeDriver.Stats emits;
+// unlike Docker's cumulative counters, it reports a single point-in-time
+// memory reading and leaves CPU percent for a future cgroups-delta pass
+type containerdMetricsJSON struct {
+	Timestamp   time.Time `json:"timestamp"`
+	MemoryUsage uint64    `json:"memory_usage_bytes"`
+	MemoryLimit uint64    `json:"memory_limit_bytes"`
+}
+
+// collectSamples decodes the newline-delimited JSON stats stream produced by
+// a driver of type dt running in the given mode, emitting one MetricSample
+// per reading no more often than interval, until the stream is exhausted or
+// fails to decode (the drivers end it when the context given to Stats is
+// canceled). It closes out when done.
+func collectSamples(dt driver.Type, mode driver.Mode, r io.Reader, interval time.Duration, out chan<- MetricSample) {
+	defer close(out)
+	if interval <= 0 {
+		interval = defaultSampleInterval
+	}
+
+	switch {
+	case dt == driver.Docker && mode == driver.ModeCLI:
+		collectDockerCLISamples(r, interval, out)
+	case dt == driver.Docker:
+		collectDockerSamples(r, interval, out)
+	case dt == driver.ContainerdNative:
+		collectContainerdSamples(r, interval, out)
+	default:
+		log.Debugf("stats sampler: no sample parser for driver type %s (mode %s); dropping stream", dt, mode)
+	}
+}
+
+func collectDockerSamples(r io.Reader, interval time.Duration, out chan<- MetricSample) {
+	decoder := json.NewDecoder(r)
+	var last time.Time
+	for {
+		var s dockerStatsJSON
+		if err := decoder.Decode(&s); err != nil {
+			if err != io.EOF {
+				log.Debugf("stats sampler: docker stream ended: %v", err)
+			}
+			return
+		}
+		if !last.IsZero() && s.Read.Sub(last) < interval {
+			continue
+		}
+		last = s.Read
+
+		var blkio uint64
+		for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+			blkio += e.Value
+		}
+		var rx, tx uint64
+		for _, n := range s.Networks {
+			rx += n.RxBytes
+			tx += n.TxBytes
+		}
+
+		// Same formula the docker CLI's `stats` command uses: delta of
+		// total CPU usage over delta of system CPU usage, scaled by the
+		// number of online CPUs.
+		cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+		sysDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+		var cpuPercent float64
+		if sysDelta > 0 && cpuDelta > 0 {
+			onlineCPUs := s.CPUStats.OnlineCPUs
+			if onlineCPUs == 0 {
+				onlineCPUs = 1
+			}
+			cpuPercent = (cpuDelta / sysDelta) * float64(onlineCPUs) * 100.0
+		}
+
+		out <- MetricSample{
+			Timestamp:        s.Read,
+			CPUPercent:       cpuPercent,
+			MemoryUsageBytes: s.MemoryStats.Usage,
+			MemoryLimitBytes: s.MemoryStats.Limit,
+			BlkioBytes:       blkio,
+			NetworkRxBytes:   rx,
+			NetworkTxBytes:   tx,
+		}
+	}
+}
+
+// collectDockerCLISamples decodes the newline-delimited, pre-formatted JSON
+// emitted by `docker stats --format {{json .}}` in ModeCLI. Unlike the raw
+// API stream this has no read timestamp, so sampling is throttled against
+// local wall-clock time instead.
+func collectDockerCLISamples(r io.Reader, interval time.Duration, out chan<- MetricSample) {
+	decoder := json.NewDecoder(r)
+	var last time.Time
+	for {
+		var s dockerCLIStatsJSON
+		if err := decoder.Decode(&s); err != nil {
+			if err != io.EOF {
+				log.Debugf("stats sampler: docker CLI stream ended: %v", err)
+			}
+			return
+		}
+		now := time.Now()
+		if !last.IsZero() && now.Sub(last) < interval {
+			continue
+		}
+		last = now
+
+		cpuPercent, err := strconv.ParseFloat(strings.TrimSuffix(s.CPUPerc, "%"), 64)
+		if err != nil {
+			log.Debugf("stats sampler: could not parse CPUPerc %q: %v", s.CPUPerc, err)
+		}
+		memUsage, memLimit := parseDockerCLIPair(s.MemUsage)
+		rx, tx := parseDockerCLIPair(s.NetIO)
+		blkRead, blkWrite := parseDockerCLIPair(s.BlockIO)
+
+		out <- MetricSample{
+			Timestamp:        now,
+			CPUPercent:       cpuPercent,
+			MemoryUsageBytes: memUsage,
+			MemoryLimitBytes: memLimit,
+			BlkioBytes:       blkRead + blkWrite,
+			NetworkRxBytes:   rx,
+			NetworkTxBytes:   tx,
+		}
+	}
+}
+
+// parseDockerCLIPair parses a "<used> / <total>" human-readable size pair as
+// emitted in the MemUsage/NetIO/BlockIO fields of `docker stats`'s CLI format
+// (e.g. "7.211MiB / 1.952GiB"), returning zero values for either side that
+// doesn't parse
+func parseDockerCLIPair(s string) (uint64, uint64) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	a, errA := units.RAMInBytes(strings.TrimSpace(parts[0]))
+	b, errB := units.RAMInBytes(strings.TrimSpace(parts[1]))
+	if errA != nil {
+		a = 0
+	}
+	if errB != nil {
+		b = 0
+	}
+	return uint64(a), uint64(b)
+}
+
+func collectContainerdSamples(r io.Reader, interval time.Duration, out chan<- MetricSample) {
+	decoder := json.NewDecoder(r)
+	var last time.Time
+	for {
+		var s containerdMetricsJSON
+		if err := decoder.Decode(&s); err != nil {
+			if err != io.EOF {
+				log.Debugf("stats sampler: containerd stream ended: %v", err)
+			}
+			return
+		}
+		if !last.IsZero() && s.Timestamp.Sub(last) < interval {
+			continue
+		}
+		last = s.Timestamp
+
+		out <- MetricSample{
+			Timestamp:        s.Timestamp,
+			MemoryUsageBytes: s.MemoryUsage,
+			MemoryLimitBytes: s.MemoryLimit,
+		}
+	}
+}
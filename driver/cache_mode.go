@@ -0,0 +1,15 @@
+package driver
+
+// CacheMode controls whether a benchmark run assumes the target image is
+// already present (warm) or forces a fresh pull on every iteration by
+// removing the image beforehand (cold)
+type CacheMode string
+
+const (
+	// CacheWarm assumes the image is already present in the local store;
+	// pull latency is only paid once, if at all
+	CacheWarm CacheMode = "warm"
+	// CacheCold removes the image before each iteration so that pull
+	// latency and cold-start behavior can be measured
+	CacheCold CacheMode = "cold"
+)
@@ -0,0 +1,20 @@
+package driver
+
+// Container describes the metadata needed by a driver to create and run
+// a container; each driver provides its own implementation
+type Container interface {
+	// Name returns the name of the container
+	Name() string
+	// Detached returns whether the container should be started in detached mode
+	Detached() bool
+	// Trace returns whether the container should be started with tracing enabled
+	Trace() bool
+	// Image returns the image name the container is based on
+	Image() string
+	// Command returns the optional overriding command used when executing
+	// the container
+	Command() string
+	// GetPodID returns the pod ID associated with the container; only used
+	// by CRI-based drivers
+	GetPodID() string
+}
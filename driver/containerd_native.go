@@ -0,0 +1,410 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/containerd/cgroups/stats/v1"
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/typeurl"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// containerdMetricsSample is the wire format this driver's Stats() emits;
+// it mirrors the subset of cgroups v1 memory stats benches.collectSamples
+// knows how to decode for this driver type
+type containerdMetricsSample struct {
+	Timestamp   time.Time `json:"timestamp"`
+	MemoryUsage uint64    `json:"memory_usage_bytes"`
+	MemoryLimit uint64    `json:"memory_limit_bytes"`
+}
+
+const (
+	defaultContainerdSocket    = "/run/containerd/containerd.sock"
+	defaultContainerdNamespace = "bucketbench"
+)
+
+// ContainerdNativeDriver is an implementation of the driver interface for
+// containerd, using containerd's Go client directly against its gRPC socket
+// rather than going through the Docker CLI/daemon shim.
+type ContainerdNativeDriver struct {
+	socketPath string
+	namespace  string
+	runID      string
+	client     *containerd.Client
+}
+
+// ContainerdNativeContainer is the container metadata tracked by the
+// containerd native driver, including the containerd task once it is started
+type ContainerdNativeContainer struct {
+	name        string
+	imageName   string
+	cmdOverride string
+	detached    bool
+	trace       bool
+
+	container containerd.Container
+	task      containerd.Task
+}
+
+// NewContainerdNativeDriver creates an instance of the containerd native driver,
+// connecting to the containerd socket at cfg.Path (or the default) using the
+// namespace given in cfg.Namespace (or "bucketbench" if unset)
+func NewContainerdNativeDriver(ctx context.Context, cfg *Config) (Driver, error) {
+	socketPath := cfg.Path
+	if socketPath == "" {
+		socketPath = defaultContainerdSocket
+	}
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = defaultContainerdNamespace
+	}
+
+	client, err := containerd.New(socketPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not connect to containerd socket %q", socketPath)
+	}
+
+	driver := &ContainerdNativeDriver{
+		socketPath: socketPath,
+		namespace:  namespace,
+		runID:      cfg.RunID,
+		client:     client,
+	}
+
+	info, err := driver.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("running containerd native driver: '%s'", info)
+	return driver, nil
+}
+
+func (d *ContainerdNativeDriver) namespacedCtx(ctx context.Context) context.Context {
+	return namespaces.WithNamespace(ctx, d.namespace)
+}
+
+// Type returns a driver.Type to identify the driver implementation
+func (d *ContainerdNativeDriver) Type() Type {
+	return ContainerdNative
+}
+
+// Path returns the containerd socket in use by the driver
+func (d *ContainerdNativeDriver) Path() string {
+	return d.socketPath
+}
+
+// Mode always reports ModeAPI; the containerd native driver only speaks
+// directly to the containerd gRPC API and has no CLI/API mode distinction
+func (d *ContainerdNativeDriver) Mode() Mode {
+	return ModeAPI
+}
+
+// Close closes the underlying containerd client connection
+func (d *ContainerdNativeDriver) Close() error {
+	return d.client.Close()
+}
+
+// PID always returns an error, since containerd's gRPC API does not expose
+// the daemon's process ID
+func (d *ContainerdNativeDriver) PID(ctx context.Context) (int, error) {
+	ctx = d.namespacedCtx(ctx)
+	version, err := d.client.Server(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not query containerd server info")
+	}
+	return 0, fmt.Errorf("containerd does not expose a daemon PID via the gRPC API (server uuid: %s)", version.UUID)
+}
+
+// Info returns version information describing the driver and containerd daemon
+func (d *ContainerdNativeDriver) Info(ctx context.Context) (string, error) {
+	ctx = d.namespacedCtx(ctx)
+	version, err := d.client.Version(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "error trying to retrieve containerd version")
+	}
+	return fmt.Sprintf("containerd native driver (socket: %s, namespace: %s) [SERVER:%s|Revision:%s]",
+		d.socketPath, d.namespace, version.Version, version.Revision), nil
+}
+
+// Pull fetches image from its registry into the local containerd content store
+func (d *ContainerdNativeDriver) Pull(ctx context.Context, image string) (string, int, error) {
+	ctx = d.namespacedCtx(ctx)
+	start := time.Now()
+	_, err := d.client.Pull(ctx, image, containerd.WithPullUnpack)
+	return "", elapsedMS(start), err
+}
+
+// RemoveImage removes image from the local containerd content store; used in
+// CacheCold mode to force a fresh pull ahead of the next iteration
+func (d *ContainerdNativeDriver) RemoveImage(ctx context.Context, image string) (string, int, error) {
+	ctx = d.namespacedCtx(ctx)
+	start := time.Now()
+	err := d.client.ImageService().Delete(ctx, image)
+	return "", elapsedMS(start), err
+}
+
+// Create will pull the image (if needed) and create a container and its
+// snapshot, but does not yet start a task for it
+func (d *ContainerdNativeDriver) Create(ctx context.Context, name, imageName, cmdOverride string, detached bool, trace bool) (Container, error) {
+	ctx = d.namespacedCtx(ctx)
+
+	image, err := d.client.Pull(ctx, imageName, containerd.WithPullUnpack)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not pull image %q", imageName)
+	}
+
+	specOpts := []oci.SpecOpts{oci.WithImageConfig(image)}
+	if cmdOverride != "" {
+		specOpts = append(specOpts, oci.WithProcessArgs(strings.Split(cmdOverride, " ")...))
+	}
+
+	ctr, err := d.client.NewContainer(ctx, name,
+		containerd.WithNewSnapshot(name+"-snapshot", image),
+		containerd.WithNewSpec(specOpts...),
+		containerd.WithContainerLabels(map[string]string{LabelRunID: d.runID}),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create container %q", name)
+	}
+
+	return &ContainerdNativeContainer{
+		name:        name,
+		imageName:   imageName,
+		cmdOverride: cmdOverride,
+		detached:    detached,
+		trace:       trace,
+		container:   ctr,
+	}, nil
+}
+
+// Run creates and starts a task for the container
+func (d *ContainerdNativeDriver) Run(ctx context.Context, c Container) (string, int, error) {
+	ctr, ok := c.(*ContainerdNativeContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("container %q was not created by the containerd native driver", c.Name())
+	}
+	ctx = d.namespacedCtx(ctx)
+
+	start := time.Now()
+	task, err := ctr.container.NewTask(ctx, cio.NullIO)
+	if err != nil {
+		return "", elapsedMS(start), errors.Wrapf(err, "could not create task for container %q", ctr.name)
+	}
+	if err := task.Start(ctx); err != nil {
+		return "", elapsedMS(start), errors.Wrapf(err, "could not start task for container %q", ctr.name)
+	}
+	ctr.task = task
+	return "", elapsedMS(start), nil
+}
+
+// Stop kills the container's task
+func (d *ContainerdNativeDriver) Stop(ctx context.Context, c Container) (string, int, error) {
+	ctr, ok := c.(*ContainerdNativeContainer)
+	if !ok || ctr.task == nil {
+		return "", 0, fmt.Errorf("container %q has no running task to stop", c.Name())
+	}
+	ctx = d.namespacedCtx(ctx)
+
+	start := time.Now()
+	exitCh, err := ctr.task.Wait(ctx)
+	if err != nil {
+		return "", elapsedMS(start), errors.Wrapf(err, "could not wait on task for container %q", ctr.name)
+	}
+	if err := ctr.task.Kill(ctx, 9); err != nil {
+		return "", elapsedMS(start), errors.Wrapf(err, "could not kill task for container %q", ctr.name)
+	}
+	<-exitCh
+	return "", elapsedMS(start), nil
+}
+
+// Wait blocks until the container's task exits
+func (d *ContainerdNativeDriver) Wait(ctx context.Context, c Container) (string, int, error) {
+	ctr, ok := c.(*ContainerdNativeContainer)
+	if !ok || ctr.task == nil {
+		return "", 0, fmt.Errorf("container %q has no running task to wait on", c.Name())
+	}
+	ctx = d.namespacedCtx(ctx)
+
+	start := time.Now()
+	exitCh, err := ctr.task.Wait(ctx)
+	if err != nil {
+		return "", elapsedMS(start), errors.Wrapf(err, "could not wait on task for container %q", ctr.name)
+	}
+	status := <-exitCh
+	return fmt.Sprintf("exit status %d", status.ExitCode()), elapsedMS(start), status.Error()
+}
+
+// Pause pauses the container's task
+func (d *ContainerdNativeDriver) Pause(ctx context.Context, c Container) (string, int, error) {
+	ctr, ok := c.(*ContainerdNativeContainer)
+	if !ok || ctr.task == nil {
+		return "", 0, fmt.Errorf("container %q has no running task to pause", c.Name())
+	}
+	ctx = d.namespacedCtx(ctx)
+
+	start := time.Now()
+	err := ctr.task.Pause(ctx)
+	return "", elapsedMS(start), err
+}
+
+// Unpause resumes the container's paused task
+func (d *ContainerdNativeDriver) Unpause(ctx context.Context, c Container) (string, int, error) {
+	ctr, ok := c.(*ContainerdNativeContainer)
+	if !ok || ctr.task == nil {
+		return "", 0, fmt.Errorf("container %q has no running task to resume", c.Name())
+	}
+	ctx = d.namespacedCtx(ctx)
+
+	start := time.Now()
+	err := ctr.task.Resume(ctx)
+	return "", elapsedMS(start), err
+}
+
+// Remove deletes the container's task (if any) and the container itself,
+// along with its snapshot
+func (d *ContainerdNativeDriver) Remove(ctx context.Context, c Container) (string, int, error) {
+	ctr, ok := c.(*ContainerdNativeContainer)
+	if !ok {
+		return "", 0, fmt.Errorf("container %q was not created by the containerd native driver", c.Name())
+	}
+	ctx = d.namespacedCtx(ctx)
+
+	start := time.Now()
+	if ctr.task != nil {
+		if _, err := ctr.task.Delete(ctx); err != nil {
+			return "", elapsedMS(start), errors.Wrapf(err, "could not delete task for container %q", ctr.name)
+		}
+	}
+	if err := ctr.container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+		return "", elapsedMS(start), errors.Wrapf(err, "could not delete container %q", ctr.name)
+	}
+	return "", elapsedMS(start), nil
+}
+
+// Execsync is not yet implemented for the containerd native driver
+func (d *ContainerdNativeDriver) Execsync(ctx context.Context, c Container, cmd []string) (string, int, error) {
+	return "", 0, fmt.Errorf("Execsync is not implemented for the containerd native driver")
+}
+
+// Stats returns the container's task metrics, serialized as JSON, on a stream
+// that emits one reading about every second until ctx is canceled
+func (d *ContainerdNativeDriver) Stats(ctx context.Context, c Container) (io.ReadCloser, error) {
+	ctr, ok := c.(*ContainerdNativeContainer)
+	if !ok || ctr.task == nil {
+		return nil, fmt.Errorf("container %q has no running task to collect metrics from", c.Name())
+	}
+	ctx = d.namespacedCtx(ctx)
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer pw.Close()
+		encoder := json.NewEncoder(pw)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			metric, err := ctr.task.Metrics(ctx)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			sample := containerdMetricsSample{Timestamp: time.Now()}
+			if data, err := typeurl.UnmarshalAny(metric.Data); err == nil {
+				if m, ok := data.(*v1.Metrics); ok && m.Memory != nil && m.Memory.Usage != nil {
+					sample.MemoryUsage = m.Memory.Usage.Usage
+					sample.MemoryLimit = m.Memory.Usage.Limit
+				}
+			}
+			if err := encoder.Encode(sample); err != nil {
+				return
+			}
+			time.Sleep(time.Second)
+		}
+	}()
+	return pr, nil
+}
+
+// Clean reconciles the containerd namespace, removing any leftover
+// bucketbench containers (and their tasks). When onlyOwn is true,
+// reconciliation is scoped to LabelRunID=d.runID so a concurrently-running
+// bucketbench invocation's containers are left untouched; when false, any
+// container carrying the LabelRunID label is reaped regardless of its
+// value, which is needed at startup to catch containers left behind by a
+// prior, now-dead run whose run-id can't be known ahead of time.
+func (d *ContainerdNativeDriver) Clean(ctx context.Context, onlyOwn bool) error {
+	ctx = d.namespacedCtx(ctx)
+	report := newReconcileReport()
+
+	filter := fmt.Sprintf(`labels."%s"`, LabelRunID)
+	if onlyOwn {
+		filter = fmt.Sprintf(`labels."%s"=="%s"`, LabelRunID, d.runID)
+	}
+	containers, err := d.client.Containers(ctx, filter)
+	if err != nil {
+		return errors.Wrap(err, "containerd: failed to list containers for cleanup")
+	}
+	for _, ctr := range containers {
+		stopCtx, cancel := context.WithTimeout(ctx, reconcileTimeout*time.Second)
+		if task, err := ctr.Task(stopCtx, nil); err == nil {
+			exitCh, waitErr := task.Wait(stopCtx)
+			if killErr := task.Kill(stopCtx, 9); killErr != nil {
+				report.Errors[ctr.ID()] = errors.Wrap(killErr, "kill failed")
+			} else if waitErr == nil {
+				<-exitCh
+			}
+			if _, err := task.Delete(stopCtx); err != nil {
+				report.Errors[ctr.ID()] = errors.Wrap(err, "task delete failed")
+			}
+		}
+		cancel()
+		if err := ctr.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+			report.Errors[ctr.ID()] = errors.Wrap(err, "container delete failed")
+			continue
+		}
+		report.Reaped = append(report.Reaped, ctr.ID())
+	}
+	report.log("containerd")
+	return nil
+}
+
+// Name returns the name of the container
+func (c *ContainerdNativeContainer) Name() string {
+	return c.name
+}
+
+// Detached returns whether the container should be started in detached mode
+func (c *ContainerdNativeContainer) Detached() bool {
+	return c.detached
+}
+
+// Trace returns whether the container should be started with tracing enabled
+func (c *ContainerdNativeContainer) Trace() bool {
+	return c.trace
+}
+
+// Image returns the image name the container is based on
+func (c *ContainerdNativeContainer) Image() string {
+	return c.imageName
+}
+
+// Command returns the optional overriding command used when executing the container
+func (c *ContainerdNativeContainer) Command() string {
+	return c.cmdOverride
+}
+
+// GetPodID return pod-id associated with container.
+// only used by CRI-based drivers
+func (c *ContainerdNativeContainer) GetPodID() string {
+	return ""
+}
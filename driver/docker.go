@@ -2,11 +2,19 @@ package driver
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
 	"github.com/estesp/bucketbench/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -15,12 +23,24 @@ import (
 const defaultDockerBinary = "docker"
 
 // DockerDriver is an implementation of the driver interface for the Docker engine.
+// It supports two modes of operation, selected via Config.DockerMode:
+//   - ModeAPI (default): talks to the daemon directly through the official
+//     Docker Engine SDK (github.com/docker/docker/client), so that reported
+//     timings reflect daemon-side latency without fork/exec or CLI parsing
+//     overhead.
+//   - ModeCLI: shells out to the `docker` binary for every lifecycle
+//     operation, as bucketbench has always done; kept around so users can
+//     run both modes back to back and compare the two paths.
+//
 // IMPORTANT: This implementation does not protect instance metadata for thread safely.
 // At this time there is no understood use case for multi-threaded use of this implementation.
 type DockerDriver struct {
+	mode         Mode
 	dockerBinary string
 	dockerInfo   string
 	logDriver    string
+	runID        string
+	client       *client.Client
 }
 
 // DockerContainer is an implementation of the container metadata needed for docker
@@ -32,28 +52,52 @@ type DockerContainer struct {
 	trace       bool
 }
 
-// NewDockerDriver creates an instance of the docker driver, providing a path to the docker client binary
-func NewDockerDriver(binaryPath string, logDriver string) (Driver, error) {
-	if binaryPath == "" {
-		binaryPath = defaultDockerBinary
+// NewDockerDriver creates an instance of the docker driver. In ModeCLI, cfg.Path
+// is resolved as the docker client binary; in ModeAPI, cfg.Path (if set) is used
+// as the daemon host (e.g. "unix:///var/run/docker.sock")
+func NewDockerDriver(ctx context.Context, cfg *Config) (Driver, error) {
+	mode := cfg.DockerMode
+	if mode == "" {
+		mode = ModeAPI
 	}
 
-	resolvedBinPath, err := utils.ResolveBinary(binaryPath)
-	if err != nil {
-		return &DockerDriver{}, err
+	driver := &DockerDriver{
+		mode:      mode,
+		logDriver: cfg.DockerLogDriver,
+		runID:     cfg.RunID,
 	}
 
-	driver := &DockerDriver{
-		dockerBinary: resolvedBinPath,
-		logDriver:    logDriver,
+	switch mode {
+	case ModeCLI:
+		binaryPath := cfg.Path
+		if binaryPath == "" {
+			binaryPath = defaultDockerBinary
+		}
+		resolvedBinPath, err := utils.ResolveBinary(binaryPath)
+		if err != nil {
+			return nil, err
+		}
+		driver.dockerBinary = resolvedBinPath
+	case ModeAPI:
+		opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+		if cfg.Path != "" {
+			opts = append(opts, client.WithHost(cfg.Path))
+		}
+		cli, err := client.NewClientWithOpts(opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create Docker SDK client")
+		}
+		driver.client = cli
+	default:
+		return nil, fmt.Errorf("unknown docker driver mode: %q", mode)
 	}
 
-	info, err := driver.Info()
+	info, err := driver.Info(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Debugf("running docker driver: '%s', log driver: '%s'", info, logDriver)
+	log.Debugf("running docker driver: '%s', mode: %s, log driver: '%s'", info, mode, cfg.DockerLogDriver)
 	return driver, nil
 }
 
@@ -106,18 +150,30 @@ func (d *DockerDriver) Type() Type {
 	return Docker
 }
 
-// Path returns the binary path of the docker binary in use
+// Path returns the binary path or daemon host in use by the driver
 func (d *DockerDriver) Path() string {
-	return d.dockerBinary
+	if d.mode == ModeCLI {
+		return d.dockerBinary
+	}
+	return d.client.DaemonHost()
+}
+
+// Mode returns the driver's configured CLI/API mode
+func (d *DockerDriver) Mode() Mode {
+	return d.mode
 }
 
 // Close allows the driver to handle any resource free/connection closing
-// as necessary. Docker has no need to perform any actions on close.
+// as necessary.
 func (d *DockerDriver) Close() error {
+	if d.mode == ModeAPI {
+		return d.client.Close()
+	}
 	return nil
 }
 
-func (d *DockerDriver) PID() (int, error) {
+// PID returns the process ID of the Docker daemon
+func (d *DockerDriver) PID(ctx context.Context) (int, error) {
 	buf, err := ioutil.ReadFile("/var/run/docker.pid")
 	if err != nil {
 		return 0, errors.Wrap(err, "could not read Docker pid file")
@@ -127,102 +183,313 @@ func (d *DockerDriver) PID() (int, error) {
 }
 
 // Wait will block until container stop
-func (d *DockerDriver) Wait(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "wait "+ctr.Name())
+func (d *DockerDriver) Wait(ctx context.Context, ctr Container) (string, int, error) {
+	if d.mode == ModeCLI {
+		return utils.ExecTimedCmd(d.dockerBinary, "wait "+ctr.Name())
+	}
+	start := time.Now()
+	statusCh, errCh := d.client.ContainerWait(ctx, ctr.Name(), container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return "", elapsedMS(start), err
+	case status := <-statusCh:
+		return fmt.Sprintf("exit status %d", status.StatusCode), elapsedMS(start), nil
+	}
 }
 
-// Info returns
-func (d *DockerDriver) Info() (string, error) {
+// Info returns version/daemon information describing the driver
+func (d *DockerDriver) Info(ctx context.Context) (string, error) {
 	if d.dockerInfo != "" {
 		return d.dockerInfo, nil
 	}
 
-	infoStart := "docker driver (binary: " + d.dockerBinary + ")\n"
-	version, err := utils.ExecCmd(d.dockerBinary, "version")
-	info, err := utils.ExecCmd(d.dockerBinary, "info")
+	if d.mode == ModeCLI {
+		infoStart := "docker driver (binary: " + d.dockerBinary + ")\n"
+		version, err := utils.ExecCmd(d.dockerBinary, "version")
+		info, err := utils.ExecCmd(d.dockerBinary, "info")
+		if err != nil {
+			return "", fmt.Errorf("Error trying to retrieve docker daemon info: %v", err)
+		}
+		d.dockerInfo = infoStart + parseDaemonInfo(version, info)
+		return d.dockerInfo, nil
+	}
+
+	infoStart := fmt.Sprintf("docker driver (mode: api, host: %s)\n", d.client.DaemonHost())
+	serverVersion, err := d.client.ServerVersion(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "error trying to retrieve docker daemon info")
+	}
+	sysInfo, err := d.client.Info(ctx)
 	if err != nil {
-		return "", fmt.Errorf("Error trying to retrieve docker daemon info: %v", err)
+		return "", errors.Wrap(err, "error trying to retrieve docker daemon info")
 	}
-	d.dockerInfo = infoStart + parseDaemonInfo(version, info)
+	d.dockerInfo = fmt.Sprintf("%s[CLIENT:%s|API:%s][SERVER:%s|API:%s|Kernel:%s|Storage:%s]",
+		infoStart, "sdk", d.client.ClientVersion(),
+		serverVersion.Version, serverVersion.APIVersion, sysInfo.KernelVersion, sysInfo.Driver)
 	return d.dockerInfo, nil
 }
 
+// Pull fetches image from its registry into the local Docker image store
+func (d *DockerDriver) Pull(ctx context.Context, image string) (string, int, error) {
+	if d.mode == ModeCLI {
+		return utils.ExecTimedCmd(d.dockerBinary, "pull "+image)
+	}
+	start := time.Now()
+	reader, err := d.client.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return "", elapsedMS(start), err
+	}
+	defer reader.Close()
+	out, err := ioutil.ReadAll(reader)
+	return string(out), elapsedMS(start), err
+}
+
+// RemoveImage removes image from the local Docker image store; used in
+// CacheCold mode to force a fresh pull ahead of the next iteration
+func (d *DockerDriver) RemoveImage(ctx context.Context, image string) (string, int, error) {
+	if d.mode == ModeCLI {
+		return utils.ExecTimedCmd(d.dockerBinary, "rmi -f "+image)
+	}
+	start := time.Now()
+	_, err := d.client.ImageRemove(ctx, image, types.ImageRemoveOptions{Force: true})
+	return "", elapsedMS(start), err
+}
+
 // Create will create a container instance matching the specific needs
 // of a driver
-func (d *DockerDriver) Create(name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+func (d *DockerDriver) Create(ctx context.Context, name, image, cmdOverride string, detached bool, trace bool) (Container, error) {
+	if d.mode == ModeAPI {
+		config := &container.Config{
+			Image:  image,
+			Labels: map[string]string{LabelRunID: d.runID},
+		}
+		if cmdOverride != "" {
+			config.Cmd = strings.Split(cmdOverride, " ")
+		}
+		hostConfig := &container.HostConfig{}
+		if d.logDriver != "" {
+			hostConfig.LogConfig = container.LogConfig{Type: d.logDriver}
+		}
+		if _, err := d.client.ContainerCreate(ctx, config, hostConfig, nil, nil, name); err != nil {
+			return nil, errors.Wrapf(err, "could not create container %q", name)
+		}
+	}
 	return newDockerContainer(name, image, cmdOverride, detached, trace), nil
 }
 
-// Clean will clean the environment; removing any exited containers
-func (d *DockerDriver) Clean() error {
-	// clean up any containers from a prior run
-	log.Info("Docker: Stopping any running containers created during bucketbench runs")
-	cmd := "docker stop `docker ps -qf name=bb-ctr-`"
-	out, err := utils.ExecShellCmd(cmd)
-	if err != nil {
-		// first make sure the error isn't simply that there were no
-		// containers to stop:
-		if !strings.Contains(out, "requires at least 1 argument") {
-			log.Warnf("Docker: Failed to stop running bb-ctr-* containers: %v (output: %s)", err, out)
+// Clean reconciles the environment, force-stopping and removing any
+// containers left behind by prior bucketbench runs (including crashed ones)
+// and reporting what it reaped.
+//
+// In ModeCLI this can only key off the container name prefix, since labels
+// aren't queryable without a second exec round-trip per container, so
+// onlyOwn has no effect there. In ModeAPI, onlyOwn scopes the label filter
+// to this driver's own run-id, so a second, concurrently-running bucketbench
+// invocation's containers are left untouched; passing false instead matches
+// on the LabelRunID key alone, which is needed at startup to catch
+// containers left behind by a prior, now-dead run whose run-id can't be
+// known ahead of time.
+func (d *DockerDriver) Clean(ctx context.Context, onlyOwn bool) error {
+	report := newReconcileReport()
+
+	if d.mode == ModeCLI {
+		log.Info("Docker: Stopping any running containers created during bucketbench runs")
+		cmd := "docker stop `docker ps -qf name=" + ContainerNamePrefix + "-`"
+		out, err := utils.ExecShellCmd(cmd)
+		if err != nil {
+			// first make sure the error isn't simply that there were no
+			// containers to stop:
+			if !strings.Contains(out, "requires at least 1 argument") {
+				log.Warnf("Docker: Failed to stop running %s-* containers: %v (output: %s)", ContainerNamePrefix, err, out)
+			}
 		}
+		log.Info("Docker: Removing exited containers from bucketbench runs")
+		cmd = "docker rm -fv `docker ps -aqf name=" + ContainerNamePrefix + "-`"
+		out, err = utils.ExecShellCmd(cmd)
+		if err != nil {
+			// first make sure the error isn't simply that there were no
+			// exited containers to remove:
+			if !strings.Contains(out, "requires at least 1 argument") {
+				log.Warnf("Docker: Failed to remove exited %s-* containers: %v (output: %s)", ContainerNamePrefix, err, out)
+			}
+		} else {
+			// docker rm prints each removed container's ID on its own line
+			report.Reaped = append(report.Reaped, strings.Fields(out)...)
+		}
+		report.log("Docker")
+		return nil
+	}
+
+	filter := labelKeyFilter(LabelRunID)
+	if onlyOwn {
+		filter = labelFilter(LabelRunID, d.runID)
 	}
-	log.Info("Docker: Removing exited containers from bucketbench runs")
-	cmd = "docker rm -f `docker ps -aqf name=bb-ctr-`"
-	out, err = utils.ExecShellCmd(cmd)
+	containers, err := d.client.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filter,
+	})
 	if err != nil {
-		// first make sure the error isn't simply that there were no
-		// exited containers to remove:
-		if !strings.Contains(out, "requires at least 1 argument") {
-			log.Warnf("Docker: Failed to remove exited bb-ctr-* containers: %v (output: %s)", err, out)
+		return errors.Wrap(err, "Docker: failed to list containers for cleanup")
+	}
+	for _, ctr := range containers {
+		timeout := reconcileTimeout * time.Second
+		if err := d.client.ContainerStop(ctx, ctr.ID, &timeout); err != nil {
+			report.Errors[ctr.ID] = errors.Wrap(err, "stop failed")
+		}
+		if err := d.client.ContainerRemove(ctx, ctr.ID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			report.Errors[ctr.ID] = errors.Wrap(err, "remove failed")
+			continue
 		}
+		report.Reaped = append(report.Reaped, ctr.ID)
 	}
+	report.log("Docker")
 	return nil
 }
 
 // Run will execute a container using the driver
-func (d *DockerDriver) Run(ctr Container) (string, int, error) {
-	args := []string{"run"}
+func (d *DockerDriver) Run(ctx context.Context, ctr Container) (string, int, error) {
+	if d.mode == ModeCLI {
+		args := []string{"run"}
 
-	if ctr.Detached() {
-		args = append(args, "-d")
-	}
+		if ctr.Detached() {
+			args = append(args, "-d")
+		}
 
-	if d.logDriver != "" {
-		args = append(args, "--log-driver", d.logDriver)
-	}
+		if d.logDriver != "" {
+			args = append(args, "--log-driver", d.logDriver)
+		}
 
-	args = append(args, "--name", ctr.Name(), ctr.Image())
+		args = append(args, "--label", LabelRunID+"="+d.runID)
+		args = append(args, "--name", ctr.Name(), ctr.Image())
 
-	if ctr.Command() != "" {
-		args = append(args, ctr.Command())
-	}
+		if ctr.Command() != "" {
+			args = append(args, ctr.Command())
+		}
 
-	return utils.ExecTimedCmd(d.dockerBinary, strings.Join(args, " "))
+		return utils.ExecTimedCmd(d.dockerBinary, strings.Join(args, " "))
+	}
+	start := time.Now()
+	err := d.client.ContainerStart(ctx, ctr.Name(), types.ContainerStartOptions{})
+	return "", elapsedMS(start), err
 }
 
 // Stop will stop/kill a container
-func (d *DockerDriver) Stop(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "kill "+ctr.Name())
+func (d *DockerDriver) Stop(ctx context.Context, ctr Container) (string, int, error) {
+	if d.mode == ModeCLI {
+		return utils.ExecTimedCmd(d.dockerBinary, "kill "+ctr.Name())
+	}
+	start := time.Now()
+	err := d.client.ContainerKill(ctx, ctr.Name(), "KILL")
+	return "", elapsedMS(start), err
 }
 
 // Remove will remove a container
-func (d *DockerDriver) Remove(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "rm "+ctr.Name())
+func (d *DockerDriver) Remove(ctx context.Context, ctr Container) (string, int, error) {
+	if d.mode == ModeCLI {
+		return utils.ExecTimedCmd(d.dockerBinary, "rm "+ctr.Name())
+	}
+	start := time.Now()
+	err := d.client.ContainerRemove(ctx, ctr.Name(), types.ContainerRemoveOptions{})
+	return "", elapsedMS(start), err
 }
 
 // Pause will pause a container
-func (d *DockerDriver) Pause(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "pause "+ctr.Name())
+func (d *DockerDriver) Pause(ctx context.Context, ctr Container) (string, int, error) {
+	if d.mode == ModeCLI {
+		return utils.ExecTimedCmd(d.dockerBinary, "pause "+ctr.Name())
+	}
+	start := time.Now()
+	err := d.client.ContainerPause(ctx, ctr.Name())
+	return "", elapsedMS(start), err
 }
 
 // Unpause will unpause/resume a container
-func (d *DockerDriver) Unpause(ctr Container) (string, int, error) {
-	return utils.ExecTimedCmd(d.dockerBinary, "unpause "+ctr.Name())
+func (d *DockerDriver) Unpause(ctx context.Context, ctr Container) (string, int, error) {
+	if d.mode == ModeCLI {
+		return utils.ExecTimedCmd(d.dockerBinary, "unpause "+ctr.Name())
+	}
+	start := time.Now()
+	err := d.client.ContainerUnpause(ctx, ctr.Name())
+	return "", elapsedMS(start), err
+}
+
+// Execsync runs the given command inside the container and blocks until it completes
+func (d *DockerDriver) Execsync(ctx context.Context, ctr Container, cmd []string) (string, int, error) {
+	if d.mode == ModeCLI {
+		return utils.ExecTimedCmd(d.dockerBinary, "exec "+ctr.Name()+" "+strings.Join(cmd, " "))
+	}
+	start := time.Now()
+	execID, err := d.client.ContainerExecCreate(ctx, ctr.Name(), types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", elapsedMS(start), err
+	}
+	resp, err := d.client.ContainerExecAttach(ctx, execID.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", elapsedMS(start), err
+	}
+	defer resp.Close()
+	out, err := ioutil.ReadAll(resp.Reader)
+	return string(out), elapsedMS(start), err
+}
+
+// Stats returns a stream of docker stats JSON for the container: raw
+// types.StatsJSON in ModeAPI, or the `docker stats --format {{json .}}`
+// output in ModeCLI
+func (d *DockerDriver) Stats(ctx context.Context, ctr Container) (io.ReadCloser, error) {
+	if d.mode == ModeCLI {
+		cmd := exec.CommandContext(ctx, d.dockerBinary, "stats", "--no-trunc", "--format", "{{json .}}", ctr.Name())
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		return &cliStatsReader{ReadCloser: stdout, cmd: cmd}, nil
+	}
+	resp, err := d.client.ContainerStats(ctx, ctr.Name(), true)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// cliStatsReader wraps the stdout pipe of a spawned `docker stats` process so
+// that Close also reaps the child via cmd.Wait; without this the process
+// spawned by exec.CommandContext is never waited on and leaks as a zombie
+// once the caller stops sampling.
+type cliStatsReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *cliStatsReader) Close() error {
+	closeErr := r.ReadCloser.Close()
+	_ = r.cmd.Process.Kill()
+	waitErr := r.cmd.Wait()
+	if closeErr != nil {
+		return closeErr
+	}
+	return waitErr
+}
+
+func elapsedMS(start time.Time) int {
+	return int(time.Since(start) / time.Millisecond)
+}
+
+func labelFilter(label, value string) filters.Args {
+	return filters.NewArgs(filters.Arg("label", label+"="+value))
 }
 
-func (d *DockerDriver) Metrics(ctr Container) (interface{}, error) {
-	output, err := utils.ExecCmd(d.dockerBinary, "stats --no-stream "+ctr.Name())
-	return output, err
+// labelKeyFilter matches any container carrying label, regardless of its
+// value; used for the startup reconciliation pass, which needs to find
+// containers left behind by a prior run whose run-id isn't known
+func labelKeyFilter(label string) filters.Args {
+	return filters.NewArgs(filters.Arg("label", label))
 }
 
 // return a condensed string of version and daemon information
@@ -0,0 +1,138 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Type identifies a specific driver implementation
+type Type int
+
+const (
+	// Docker identifies the Docker engine driver
+	Docker Type = iota
+	// ContainerdNative identifies the driver which talks directly to containerd
+	ContainerdNative
+)
+
+// ContainerNamePrefix is the prefix given to all containers created during
+// a bucketbench run so that cleanup/reconciliation passes can find them
+const ContainerNamePrefix = "bb-ctr"
+
+// LabelRunID is the label key set on every container bucketbench creates,
+// tagged with the owning run's UUID, so a reconciliation pass can reliably
+// tell bucketbench-owned containers apart from unrelated ones sharing the
+// same name prefix
+const LabelRunID = "bucketbench.run-id"
+
+// String returns a human readable name for a driver Type
+func (t Type) String() string {
+	switch t {
+	case Docker:
+		return "Docker"
+	case ContainerdNative:
+		return "ContainerdNative"
+	default:
+		return "unknown"
+	}
+}
+
+// Config carries the settings needed to instantiate any of the supported
+// drivers. Fields not relevant to a given driver type are simply ignored.
+type Config struct {
+	DriverType Type
+	// Path is the binary path (CLI-mode drivers) or the daemon socket path
+	// (API/gRPC-mode drivers)
+	Path string
+	// DockerLogDriver optionally overrides the log driver used for
+	// containers started via the Docker driver
+	DockerLogDriver string
+	// DockerMode selects between the "cli" (shell out to the docker binary)
+	// and "api" (official Docker Engine SDK) implementations of the Docker
+	// driver; defaults to "api" when empty. This package exposes the
+	// setting but does not itself parse a "--docker-mode" flag; that is
+	// left to whatever CLI entrypoint constructs a Config.
+	DockerMode Mode
+	// Namespace selects the containerd namespace used by the containerd
+	// native driver; defaults to "bucketbench" when empty
+	Namespace string
+	// CacheMode selects whether image pulls are timed against a warm or
+	// a forced-cold local image cache; defaults to CacheWarm when empty
+	CacheMode CacheMode
+	// RunID uniquely identifies this bucketbench invocation; it is stamped
+	// onto every container created via the LabelRunID label so that Clean
+	// can reliably reconcile bucketbench-owned containers. A random UUID
+	// is generated if left empty.
+	RunID string
+}
+
+// Driver defines the interface that any engine/runtime driver must implement
+// in order to be benchmarked by bucketbench
+type Driver interface {
+	// Type returns a driver.Type to identify the driver implementation
+	Type() Type
+	// Path returns the binary path or daemon socket in use by the driver
+	Path() string
+	// Mode reports which CLI/API implementation strategy this driver
+	// instance uses, so callers that need to interpret a driver-specific
+	// wire format (e.g. Stats) can key off it; drivers with no such
+	// distinction report ModeAPI
+	Mode() Mode
+	// Create will create a container instance matching the specific needs
+	// of a driver
+	Create(ctx context.Context, name, image, cmdOverride string, detached, trace bool) (Container, error)
+	// Pull fetches image from its registry into the local store, timed as
+	// its own operation so pull throughput/cold-start latency can be
+	// measured independent of Create/Run
+	Pull(ctx context.Context, image string) (string, int, error)
+	// RemoveImage removes image from the local store; used ahead of each
+	// iteration in CacheCold mode to force a fresh pull
+	RemoveImage(ctx context.Context, image string) (string, int, error)
+	// Clean will reconcile the environment, removing any containers left
+	// over from prior bucketbench runs. When onlyOwn is true, reconciliation
+	// is scoped to containers carrying this driver instance's own run-id
+	// label value, e.g. the final cleanup at the end of a run should only
+	// touch what this run created. When onlyOwn is false, any container
+	// carrying the LabelRunID label is reaped regardless of its value, e.g.
+	// the startup reconciliation pass in Init needs to catch containers
+	// left behind by a prior, now-dead run whose run-id can't be known
+	// ahead of time.
+	Clean(ctx context.Context, onlyOwn bool) error
+	// Close allows the driver to free any resources/connections it holds
+	Close() error
+	// Info returns a string with driver and daemon/runtime version info
+	Info(ctx context.Context) (string, error)
+	// PID returns the process ID of the daemon/runtime being driven
+	PID(ctx context.Context) (int, error)
+	// Stats returns a stream of raw, runtime-specific stats/metrics JSON
+	// for the given container; the caller is responsible for closing it
+	Stats(ctx context.Context, ctr Container) (io.ReadCloser, error)
+	// Run will start a created container
+	Run(ctx context.Context, ctr Container) (string, int, error)
+	// Stop will stop/kill a running container
+	Stop(ctx context.Context, ctr Container) (string, int, error)
+	// Remove will remove a container
+	Remove(ctx context.Context, ctr Container) (string, int, error)
+	// Pause will pause a running container
+	Pause(ctx context.Context, ctr Container) (string, int, error)
+	// Unpause will unpause/resume a paused container
+	Unpause(ctx context.Context, ctr Container) (string, int, error)
+	// Wait will block until the container stops
+	Wait(ctx context.Context, ctr Container) (string, int, error)
+	// Execsync runs the given command inside the container and blocks
+	// until it completes
+	Execsync(ctx context.Context, ctr Container, cmd []string) (string, int, error)
+}
+
+// New instantiates the driver implementation matching cfg.DriverType
+func New(ctx context.Context, cfg *Config) (Driver, error) {
+	switch cfg.DriverType {
+	case Docker:
+		return NewDockerDriver(ctx, cfg)
+	case ContainerdNative:
+		return NewContainerdNativeDriver(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("unknown driver type: %v", cfg.DriverType)
+	}
+}
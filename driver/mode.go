@@ -0,0 +1,13 @@
+package driver
+
+// Mode selects the implementation strategy used by a driver that supports
+// more than one way of talking to its engine, e.g. the Docker driver's
+// choice between shelling out to the CLI and using the Engine SDK
+type Mode string
+
+const (
+	// ModeCLI drives the engine by shelling out to its command-line client
+	ModeCLI Mode = "cli"
+	// ModeAPI drives the engine directly via its client SDK
+	ModeAPI Mode = "api"
+)
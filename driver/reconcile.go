@@ -0,0 +1,43 @@
+package driver
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// reconcileTimeout bounds how long a Clean pass waits for a single
+// leftover container to stop before moving on to removal
+const reconcileTimeout = 5
+
+// ReconcileReport summarizes what a driver's Clean pass found and reaped,
+// so callers (and logs) get visibility into dangling-container GC instead
+// of it happening silently
+type ReconcileReport struct {
+	// Reaped lists the container names/IDs that were force-stopped and removed
+	Reaped []string
+	// Errors maps a container name/ID to the error encountered while
+	// reconciling it; a container can appear here and still be in Reaped
+	// if, e.g., stop failed but remove succeeded
+	Errors map[string]error
+}
+
+// newReconcileReport returns an empty, ready-to-use ReconcileReport
+func newReconcileReport() *ReconcileReport {
+	return &ReconcileReport{Errors: make(map[string]error)}
+}
+
+// log emits the reconciliation results as a single structured log line
+func (r *ReconcileReport) log(driverName string) {
+	if len(r.Reaped) == 0 && len(r.Errors) == 0 {
+		log.Infof("%s: reconciliation found no leftover containers", driverName)
+		return
+	}
+	log.WithFields(log.Fields{
+		"driver":      driverName,
+		"reaped":      r.Reaped,
+		"reapedCount": len(r.Reaped),
+		"errorCount":  len(r.Errors),
+	}).Info("reconciliation complete")
+	for id, err := range r.Errors {
+		log.Warnf("%s: reconciliation error on %s: %v", driverName, id, err)
+	}
+}
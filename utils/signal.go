@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SetupSignalContext returns a context derived from parent that is canceled
+// on the first SIGINT or SIGTERM, so a long-running benchmark can be asked
+// to wind down (finish in-flight cleanup, mark its run Aborted) instead of
+// being killed outright. The CLI entrypoint should call this once around
+// the root context before invoking Benchmark.Run.
+//
+// This repo currently has no cmd/main package, so nothing in-tree calls
+// this yet; it is exported for whatever entrypoint is built on top of
+// this library.
+func SetupSignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigCh:
+			log.Infof("received signal %v, canceling benchmark run", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigCh)
+	}()
+
+	return ctx, cancel
+}
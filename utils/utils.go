@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ResolveBinary resolves a binary name/path to an absolute path using the
+// host's PATH, erroring out if it cannot be found
+func ResolveBinary(binary string) (string, error) {
+	resolved, err := exec.LookPath(binary)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not resolve binary %q", binary)
+	}
+	return resolved, nil
+}
+
+// ExecCmd runs binary with the given space-separated args and returns its
+// combined output
+func ExecCmd(binary, args string) (string, error) {
+	out, err := exec.Command(binary, strings.Split(args, " ")...).CombinedOutput()
+	return string(out), err
+}
+
+// ExecShellCmd runs cmd through the host shell and returns its combined output
+func ExecShellCmd(cmd string) (string, error) {
+	out, err := exec.Command("/bin/sh", "-c", cmd).CombinedOutput()
+	return string(out), err
+}
+
+// ExecTimedCmd runs binary with the given space-separated args and returns
+// its combined output along with the elapsed time, in milliseconds, the
+// command took to complete
+func ExecTimedCmd(binary, args string) (string, int, error) {
+	start := time.Now()
+	out, err := exec.Command(binary, strings.Split(args, " ")...).CombinedOutput()
+	elapsed := int(time.Since(start) / time.Millisecond)
+	return string(out), elapsed, err
+}